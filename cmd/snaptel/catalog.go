@@ -0,0 +1,355 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// CatalogFilter narrows a CatalogSource.Search call the same way
+// listCatalog's --plugin-type/--plugin-name flags narrow the legacy web
+// API listing.
+type CatalogFilter struct {
+	Type string
+	Name string
+}
+
+func (f CatalogFilter) matches(p Plugin) bool {
+	if f.Type != "" && !strings.Contains(p.Type, f.Type) {
+		return false
+	}
+	if f.Name != "" && !strings.Contains(p.FullName, f.Name) && !strings.Contains(p.Name, f.Name) {
+		return false
+	}
+	return true
+}
+
+// CatalogSource is a backend listCatalog can search and download plugins
+// from. Operators can configure any mix of sources - e.g. the public web
+// API plus an internal GitHub org or air-gapped directory mirror.
+type CatalogSource interface {
+	Name() string
+	Search(query CatalogFilter) ([]Plugin, error)
+	Fetch(name, version string) (io.ReadCloser, error)
+}
+
+// webAPICatalogSource is the original snap-telemetry hosted catalog.
+type webAPICatalogSource struct {
+	baseURL string
+}
+
+func (s *webAPICatalogSource) Name() string { return "web-api:" + s.baseURL }
+
+func (s *webAPICatalogSource) Search(query CatalogFilter) ([]Plugin, error) {
+	body, err := getPluginData(s.baseURL)
+	if err != nil {
+		return nil, err
+	}
+	var plugins []Plugin
+	if err := json.Unmarshal(body, &plugins); err != nil {
+		return nil, err
+	}
+	return Filter(plugins, query.matches), nil
+}
+
+func (s *webAPICatalogSource) Fetch(name, version string) (io.ReadCloser, error) {
+	url := fmt.Sprintf("%s/%s/%s", s.baseURL, name, version)
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// githubOrgCatalogSource discovers plugins by listing an organization's
+// repositories tagged with the "snap-plugin" topic, each of which
+// publishes its binaries as GitHub release assets.
+type githubOrgCatalogSource struct {
+	org string
+}
+
+// ghRepoOwner is the "owner" object nested in a GitHub repos API response.
+type ghRepoOwner struct {
+	Login string `json:"login"`
+}
+
+func (s *githubOrgCatalogSource) Name() string { return "github:" + s.org }
+
+func (s *githubOrgCatalogSource) Search(query CatalogFilter) ([]Plugin, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("https://api.github.com/orgs/%s/repos", s.org), nil)
+	if err != nil {
+		return nil, err
+	}
+	// Repository topics are a preview API.
+	req.Header.Set("Accept", "application/vnd.github.mercy-preview+json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var repos []struct {
+		Name        string      `json:"name"`
+		FullName    string      `json:"full_name"`
+		Description string      `json:"description"`
+		Owner       ghRepoOwner `json:"owner"`
+		Topics      []string    `json:"topics"`
+		StarCount   int         `json:"stargazers_count"`
+		ForksCount  int         `json:"forks_count"`
+		Watchers    int         `json:"watchers_count"`
+		OpenIssues  int         `json:"open_issues_count"`
+	}
+	if err := json.Unmarshal(body, &repos); err != nil {
+		return nil, err
+	}
+
+	plugins := make([]Plugin, 0, len(repos))
+	for _, repo := range repos {
+		if !hasTopic(repo.Topics, "snap-plugin") {
+			continue
+		}
+		plugins = append(plugins, Plugin{
+			Name:        repo.Name,
+			FullName:    repo.FullName,
+			Owner:       repo.Owner.Login,
+			Description: repo.Description,
+			Stars:       repo.StarCount,
+			Forks:       repo.ForksCount,
+			Watchers:    repo.Watchers,
+			Issues:      repo.OpenIssues,
+		})
+	}
+	return Filter(plugins, query.matches), nil
+}
+
+func hasTopic(topics []string, want string) bool {
+	for _, t := range topics {
+		if t == want {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *githubOrgCatalogSource) Fetch(name, version string) (io.ReadCloser, error) {
+	body, err := getPluginData(fmt.Sprintf("https://api.github.com/repos/%s/%s/releases/latest", s.org, name))
+	if err != nil {
+		return nil, err
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, err
+	}
+	assets, err := parseAssets(data)
+	if err != nil {
+		return nil, err
+	}
+	asset, err := findAsset(assets, name, defaultAssetNameTemplate, runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.Get(asset.URL)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// directoryCatalogSource reads a local directory of .json plugin
+// manifests, letting operators mirror a catalog for air-gapped
+// environments.
+type directoryCatalogSource struct {
+	dir string
+}
+
+func (s *directoryCatalogSource) Name() string { return "directory:" + s.dir }
+
+func (s *directoryCatalogSource) Search(query CatalogFilter) ([]Plugin, error) {
+	entries, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	plugins := make([]Plugin, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		body, err := ioutil.ReadFile(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var p Plugin
+		if err := json.Unmarshal(body, &p); err != nil {
+			return nil, fmt.Errorf("Error parsing %s: %v", entry.Name(), err)
+		}
+		plugins = append(plugins, p)
+	}
+	return Filter(plugins, query.matches), nil
+}
+
+func (s *directoryCatalogSource) Fetch(name, version string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(s.dir, fmt.Sprintf("%s-%s", name, version)))
+}
+
+// ociCatalogSource pulls plugins distributed as OCI artifacts from a
+// Docker Registry HTTP API v2 endpoint: the plugin binary is a blob,
+// addressed the same way its manifest is.
+type ociCatalogSource struct {
+	registry string
+}
+
+func (s *ociCatalogSource) Name() string { return "oci:" + s.registry }
+
+func (s *ociCatalogSource) Search(query CatalogFilter) ([]Plugin, error) {
+	body, err := getPluginData(fmt.Sprintf("https://%s/v2/_catalog", s.registry))
+	if err != nil {
+		return nil, err
+	}
+	var catalog struct {
+		Repositories []string `json:"repositories"`
+	}
+	if err := json.Unmarshal(body, &catalog); err != nil {
+		return nil, err
+	}
+	plugins := make([]Plugin, 0, len(catalog.Repositories))
+	for _, repo := range catalog.Repositories {
+		plugins = append(plugins, Plugin{Name: repo, FullName: fmt.Sprintf("%s/%s", s.registry, repo)})
+	}
+	return Filter(plugins, query.matches), nil
+}
+
+func (s *ociCatalogSource) Fetch(name, version string) (io.ReadCloser, error) {
+	manifestURL := fmt.Sprintf("https://%s/v2/%s/manifests/%s", s.registry, name, version)
+	body, err := getPluginData(manifestURL)
+	if err != nil {
+		return nil, err
+	}
+	var manifest struct {
+		Layers []struct {
+			Digest string `json:"digest"`
+		} `json:"layers"`
+	}
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return nil, err
+	}
+	if len(manifest.Layers) == 0 {
+		return nil, fmt.Errorf("Manifest for %s:%s has no layers", name, version)
+	}
+	blobURL := fmt.Sprintf("https://%s/v2/%s/blobs/%s", s.registry, name, manifest.Layers[0].Digest)
+	resp, err := http.Get(blobURL)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// catalogSources returns every CatalogSource configured for this
+// installation, built from the same channels.json that fetchRegistry
+// reads for `snapctl plugin search`/`install` - so operators configure a
+// single list of channels to point both discovery paths at a mirror,
+// instead of maintaining the JSON5 channel list and a catalog source
+// config separately. Each channel's Type selects which CatalogSource
+// backend it is read by; channels with no Type (or "json5") are only
+// meaningful to fetchRegistry and are skipped here. The original
+// snap-telemetry web API is always included for backwards compatibility.
+func catalogSources() []CatalogSource {
+	sources := []CatalogSource{
+		&webAPICatalogSource{baseURL: "http://staging.webapi.snap-telemetry.io/plugin"},
+	}
+
+	channels, err := loadChannels()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: could not load plugin channels: %v\n", err)
+		return sources
+	}
+	for _, c := range channels {
+		switch c.Type {
+		case "github":
+			sources = append(sources, &githubOrgCatalogSource{org: c.URL})
+		case "directory":
+			sources = append(sources, &directoryCatalogSource{dir: c.URL})
+		case "oci":
+			sources = append(sources, &ociCatalogSource{registry: c.URL})
+		}
+	}
+	return sources
+}
+
+// searchCatalogs queries every source concurrently and merges the
+// results, deduplicating by FullName so a plugin mirrored by more than
+// one source is only listed once. Entries with no FullName - expected
+// from sources like directoryCatalogSource, whose manifests aren't
+// required to set one - are never deduplicated against each other, since
+// treating every empty FullName as the same key would silently collapse
+// unrelated plugins down to one.
+func searchCatalogs(sources []CatalogSource, query CatalogFilter) []Plugin {
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		merged  = make(map[string]Plugin)
+		ordered []string
+		anon    int
+	)
+
+	for _, source := range sources {
+		wg.Add(1)
+		go func(source CatalogSource) {
+			defer wg.Done()
+			plugins, err := source.Search(query)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "warning: %s: %v\n", source.Name(), err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, p := range plugins {
+				key := p.FullName
+				if key == "" {
+					anon++
+					key = fmt.Sprintf("\x00anon:%d", anon)
+				}
+				if _, seen := merged[key]; !seen {
+					ordered = append(ordered, key)
+				}
+				merged[key] = p
+			}
+		}(source)
+	}
+	wg.Wait()
+
+	results := make([]Plugin, 0, len(ordered))
+	for _, name := range ordered {
+		results = append(results, merged[name])
+	}
+	return results
+}
@@ -0,0 +1,109 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io"
+	"testing"
+)
+
+type fakeCatalogSource struct {
+	name    string
+	plugins []Plugin
+}
+
+func (s *fakeCatalogSource) Name() string { return s.name }
+
+func (s *fakeCatalogSource) Search(query CatalogFilter) ([]Plugin, error) {
+	return s.plugins, nil
+}
+
+func (s *fakeCatalogSource) Fetch(name, version string) (io.ReadCloser, error) {
+	return nil, nil
+}
+
+func TestSearchCatalogsDedupesByFullName(t *testing.T) {
+	sources := []CatalogSource{
+		&fakeCatalogSource{name: "a", plugins: []Plugin{{FullName: "acme/foo", Name: "foo"}}},
+		&fakeCatalogSource{name: "b", plugins: []Plugin{{FullName: "acme/foo", Name: "foo"}}},
+	}
+
+	results := searchCatalogs(sources, CatalogFilter{})
+	if len(results) != 1 {
+		t.Fatalf("expected duplicate FullName across sources to collapse to 1 result, got %d", len(results))
+	}
+}
+
+func TestCatalogSourcesBuildsFromConfiguredChannels(t *testing.T) {
+	defer withTempHome(t)()
+
+	channels := []PluginChannel{
+		{Name: "internal-github", Type: "github", URL: "acme-corp"},
+		{Name: "internal-mirror", Type: "directory", URL: "/srv/plugins"},
+		{Name: "json5-only", URL: "https://example.com/channel.json5"},
+	}
+	if err := saveChannels(channels); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sources := catalogSources()
+
+	var sawGithub, sawDirectory bool
+	for _, s := range sources {
+		switch src := s.(type) {
+		case *githubOrgCatalogSource:
+			if src.org != "acme-corp" {
+				t.Fatalf("expected github source org acme-corp, got %s", src.org)
+			}
+			sawGithub = true
+		case *directoryCatalogSource:
+			if src.dir != "/srv/plugins" {
+				t.Fatalf("expected directory source /srv/plugins, got %s", src.dir)
+			}
+			sawDirectory = true
+		}
+	}
+	if !sawGithub {
+		t.Fatalf("expected a github CatalogSource built from the configured channel")
+	}
+	if !sawDirectory {
+		t.Fatalf("expected a directory CatalogSource built from the configured channel")
+	}
+	// The json5-only channel has no Type meaningful to catalogSources and
+	// must not produce an extra source beyond the web API default plus
+	// the two above.
+	if len(sources) != 3 {
+		t.Fatalf("expected exactly 3 catalog sources (web API + github + directory), got %d", len(sources))
+	}
+}
+
+func TestSearchCatalogsDoesNotCollapseEmptyFullNames(t *testing.T) {
+	sources := []CatalogSource{
+		&fakeCatalogSource{name: "local", plugins: []Plugin{
+			{Name: "foo"},
+			{Name: "bar"},
+		}},
+	}
+
+	results := searchCatalogs(sources, CatalogFilter{})
+	if len(results) != 2 {
+		t.Fatalf("expected distinct plugins with empty FullName to both survive, got %d", len(results))
+	}
+}
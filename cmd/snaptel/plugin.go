@@ -237,33 +237,11 @@ func getPluginData(url string) ([]byte, error) {
 }
 
 func listCatalog(ctx *cli.Context) error {
-	body, err := getPluginData("http://staging.webapi.snap-telemetry.io/plugin")
-	if err != nil {
-		return err
-	}
-	pluginNames := make([]Plugin, 0)
-	err = json.Unmarshal(body, &pluginNames)
-	if err != nil {
-		return err
-	}
-	pType := ctx.String("plugin-type")
-	pName := ctx.String("plugin-name")
-	if pType != "" && pName != "" {
-		pluginNames = Filter(pluginNames, func(v Plugin) bool {
-			return strings.Contains(v.Type, pType) && strings.Contains(v.FullName, pName)
-		})
-	} else {
-		if pType != "" {
-			pluginNames = Filter(pluginNames, func(v Plugin) bool {
-				return strings.Contains(v.Type, pType)
-			})
-		}
-		if pName != "" {
-			pluginNames = Filter(pluginNames, func(v Plugin) bool {
-				return strings.Contains(v.FullName, pName) || strings.Contains(v.Name, pName)
-			})
-		}
+	query := CatalogFilter{
+		Type: ctx.String("plugin-type"),
+		Name: ctx.String("plugin-name"),
 	}
+	pluginNames := searchCatalogs(catalogSources(), query)
 	output, _ := json.MarshalIndent(pluginNames, "", "    ")
 	fmt.Printf(string(output))
 	return nil
@@ -274,7 +252,11 @@ func downloadPlugin(ctx *cli.Context) error {
 		return newUsageError("Incorrect usage:", ctx)
 	}
 	url := ctx.Args().Get(0)
-	download(url, "")
+	digest, err := download(url, "")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Stored as sha256:%s\n", digest)
 	return nil
 }
 
@@ -329,53 +311,133 @@ func downloadxPlugin(ctx *cli.Context) error {
 		return err
 	}
 
+	assets, err := parseAssets(data)
+	if err != nil {
+		return err
+	}
+
+	template := ctx.String("asset-template")
+	if template == "" {
+		template = defaultAssetNameTemplate
+	}
+	asset, err := findAsset(assets, pluginName, template, runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return err
+	}
+
+	var digest string
+	if parallel := ctx.Int("parallel"); parallel > 1 {
+		digest, err = downloadChunked(asset.URL, asset.Name, parallel)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: parallel download failed (%v), falling back to a single stream\n", err)
+			digest, err = download(asset.URL, asset.Name)
+		}
+	} else {
+		digest, err = download(asset.URL, asset.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	if checksums, ok := findChecksumsAsset(assets); ok {
+		body, err := getPluginData(checksums.URL)
+		if err != nil {
+			return fmt.Errorf("Error fetching %s: %v", checksums.Name, err)
+		}
+		sums := parseChecksums(body)
+		if want, ok := sums[asset.Name]; ok && want != digest {
+			return fmt.Errorf("Checksum mismatch for %s: expected %s from %s, got %s", asset.Name, want, checksums.Name, digest)
+		}
+	}
+
+	var sigDigest string
+	if sigAsset, ok := findSignatureAsset(assets, asset.Name); ok {
+		sigDigest, err = fetchAndStoreSignature(sigAsset.URL)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v, installing unsigned\n", err)
+		}
+	}
+
 	tag := strings.Split(data["tag_name"].(string), ".")[0]
-	os := runtime.GOOS
-	var arch string
-	switch runtime.GOARCH {
-	case "amd64":
-		arch = "x86_64"
-	case "386":
-		arch = "x86_32"
-	// case "arm":
-	// 	arch =
-	// case "s390x":
-	// 	arch =
-	default:
-		return fmt.Errorf("This arch is not yet supported")
-	}
-	downloadLink := fmt.Sprintf("https://github.com/intelsdi-x/%s/releases/download/%v/snap-plugin-publisher-file_%s_%s", pluginName, tag, os, arch)
-	download(downloadLink, pluginName)
+	version := strings.TrimPrefix(tag, "v")
+	if err := storeManifest(PluginManifest{
+		Name:            pluginName,
+		Version:         version,
+		Digest:          digest,
+		SignatureDigest: sigDigest,
+	}); err != nil {
+		return fmt.Errorf("Error recording manifest for %s: %v", pluginName, err)
+	}
+	fmt.Printf("Installed %s@%s (sha256:%s)\n", pluginName, version, digest)
 	return nil
 }
 
-func download(url, name string) error {
-	tokens := strings.Split(url, "/")
-	var fileName string
-	fileName = name
-	if name == "" {
+// download fetches url to a resumable partial file, reporting progress
+// on the terminal as it goes, then stores the completed file in the
+// content-addressable blob store under its SHA-256 digest and returns
+// that digest. name is used only for progress-bar labeling and to pick
+// a human-friendly label; the permanent location of the content is
+// always keyed by digest.
+//
+// If a previous, interrupted download of the same url left a partial
+// file behind, download resumes it with a Range request rather than
+// starting over.
+func download(url, name string) (digest string, err error) {
+	fileName := name
+	if fileName == "" {
+		tokens := strings.Split(url, "/")
 		fileName = tokens[len(tokens)-1]
 	}
-	fmt.Println("Downloading", url, "to", fileName)
 
-	// TODO: check file existence first with io.IsExist
-	output, err := os.Create(fileName)
+	partial, err := partialDownloadPath(url)
 	if err != nil {
-		return fmt.Errorf("Error while creating %s: %v", fileName, err)
+		return "", err
+	}
+
+	var offset int64
+	if info, statErr := os.Stat(partial); statErr == nil {
+		offset = info.Size()
 	}
-	defer output.Close()
 
-	response, err := http.Get(url)
+	fmt.Println("Downloading", url, "to", fileName)
+	response, err := httpGetRetry(url, offset)
 	if err != nil {
-		return fmt.Errorf("Error while downloading %s: %v", url, err)
+		return "", fmt.Errorf("Error while downloading %s: %v", url, err)
 	}
 	defer response.Body.Close()
 
-	n, err := io.Copy(output, response.Body)
+	resuming := offset > 0 && response.StatusCode == http.StatusPartialContent
+	flags := os.O_CREATE | os.O_WRONLY
+	if resuming {
+		flags |= os.O_APPEND
+	} else {
+		flags |= os.O_TRUNC
+		offset = 0
+	}
+	output, err := os.OpenFile(partial, flags, 0644)
 	if err != nil {
-		return fmt.Errorf("Error while downloading %s: %v", url, err)
+		return "", fmt.Errorf("Error while creating %s: %v", partial, err)
 	}
+	defer output.Close()
 
-	fmt.Println(n, "bytes downloaded.")
-	return nil
+	total := response.ContentLength
+	if total > 0 {
+		total += offset
+	}
+	reader := newProgressReader(response.Body, fileName, total)
+	reader.downloaded = offset
+
+	if _, err := io.Copy(output, reader); err != nil {
+		return "", fmt.Errorf("Error while downloading %s: %v", url, err)
+	}
+	if err := output.Close(); err != nil {
+		return "", err
+	}
+
+	digest, err = storeBlob(partial)
+	if err != nil {
+		return "", fmt.Errorf("Error storing %s in blob store: %v", fileName, err)
+	}
+	os.Remove(partial)
+	return digest, nil
 }
@@ -0,0 +1,165 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// archAliases maps a runtime.GOARCH value to the names release assets
+// commonly use for it, tried in order.
+var archAliases = map[string][]string{
+	"amd64": {"amd64", "x86_64"},
+	"386":   {"386", "x86_32", "i386"},
+	"arm64": {"arm64", "aarch64"},
+	"arm":   {"arm", "armv7"},
+	"s390x": {"s390x"},
+}
+
+// defaultAssetNameTemplate is the naming template used to match a GitHub
+// release asset to the current platform. "{plugin}" is replaced with the
+// plugin's repository name, "{os}" with runtime.GOOS, and "{arch}" with
+// each of that GOARCH's aliases in turn.
+const defaultAssetNameTemplate = "{plugin}_{os}_{arch}"
+
+// releaseAsset is the subset of a GitHub release asset snaptel cares
+// about.
+type releaseAsset struct {
+	Name string
+	URL  string
+}
+
+func parseAssets(data map[string]interface{}) ([]releaseAsset, error) {
+	raw, ok := data["assets"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Release data did not contain an assets list")
+	}
+	assets := make([]releaseAsset, 0, len(raw))
+	for _, v := range raw {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := m["name"].(string)
+		url, _ := m["browser_download_url"].(string)
+		assets = append(assets, releaseAsset{Name: name, URL: url})
+	}
+	return assets, nil
+}
+
+// assetNotFoundError is returned when no release asset matches the
+// current platform, and lists every asset name that was available so
+// the user can pick one manually instead of seeing a bare "unsupported".
+type assetNotFoundError struct {
+	plugin    string
+	goos      string
+	goarch    string
+	available []string
+}
+
+func (e *assetNotFoundError) Error() string {
+	return fmt.Sprintf(
+		"No release asset for %s matches %s/%s. Available assets:\n  %s",
+		e.plugin, e.goos, e.goarch, strings.Join(e.available, "\n  "),
+	)
+}
+
+// knownAssetExtensions are the file extensions a rendered asset name may
+// be suffixed with. Matching requires the asset name equal the rendered
+// name plus exactly one of these (or none) - never a bare substring
+// match, which would also accept an unrelated asset whose name happens
+// to contain this one's, or a same-release sidecar like a ".asc"/".sig"
+// file.
+var knownAssetExtensions = []string{"", ".tar.gz", ".tgz", ".zip", ".exe"}
+
+// findAsset picks the release asset matching pluginName/goos/goarch under
+// template, trying every known alias for goarch in turn.
+func findAsset(assets []releaseAsset, pluginName, template, goos, goarch string) (releaseAsset, error) {
+	aliases, ok := archAliases[goarch]
+	if !ok {
+		aliases = []string{goarch}
+	}
+
+	for _, arch := range aliases {
+		name := strings.NewReplacer(
+			"{plugin}", pluginName,
+			"{os}", goos,
+			"{arch}", arch,
+		).Replace(template)
+
+		for _, ext := range knownAssetExtensions {
+			want := name + ext
+			for _, asset := range assets {
+				if asset.Name == want {
+					return asset, nil
+				}
+			}
+		}
+	}
+
+	available := make([]string, 0, len(assets))
+	for _, asset := range assets {
+		available = append(available, asset.Name)
+	}
+	return releaseAsset{}, &assetNotFoundError{
+		plugin: pluginName, goos: goos, goarch: goarch, available: available,
+	}
+}
+
+// findSignatureAsset returns the detached-signature asset for binaryName,
+// if the release publishes one.
+func findSignatureAsset(assets []releaseAsset, binaryName string) (releaseAsset, bool) {
+	for _, asset := range assets {
+		if asset.Name == binaryName+".asc" {
+			return asset, true
+		}
+	}
+	return releaseAsset{}, false
+}
+
+// findChecksumsAsset returns the checksums manifest asset for a release,
+// if the release publishes one.
+func findChecksumsAsset(assets []releaseAsset) (releaseAsset, bool) {
+	for _, asset := range assets {
+		switch asset.Name {
+		case "checksums.txt", "SHA256SUMS", "sha256sums.txt":
+			return asset, true
+		}
+	}
+	return releaseAsset{}, false
+}
+
+// parseChecksums parses the common "<digest>  <filename>" format used by
+// checksums.txt/SHA256SUMS files into a map from filename to digest.
+func parseChecksums(body []byte) map[string]string {
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		sums[fields[1]] = fields[0]
+	}
+	return sums
+}
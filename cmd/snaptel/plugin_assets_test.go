@@ -0,0 +1,95 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import "testing"
+
+func TestFindAssetExactMatch(t *testing.T) {
+	assets := []releaseAsset{
+		{Name: "snap-plugin-collector-psutil_linux_x86_64.asc", URL: "https://example.com/asc"},
+		{Name: "snap-plugin-collector-psutil_linux_x86_64", URL: "https://example.com/bin"},
+	}
+
+	asset, err := findAsset(assets, "snap-plugin-collector-psutil", defaultAssetNameTemplate, "linux", "amd64")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if asset.URL != "https://example.com/bin" {
+		t.Fatalf("expected the binary asset, got sidecar %q", asset.URL)
+	}
+}
+
+func TestFindAssetDoesNotMatchSidecarAlone(t *testing.T) {
+	// The .asc sidecar's name contains the binary's name as a substring;
+	// with no binary asset present it must not be matched at all.
+	assets := []releaseAsset{
+		{Name: "snap-plugin-collector-psutil_linux_x86_64.asc", URL: "https://example.com/asc"},
+	}
+
+	_, err := findAsset(assets, "snap-plugin-collector-psutil", defaultAssetNameTemplate, "linux", "amd64")
+	if err == nil {
+		t.Fatalf("expected no match when only a sidecar asset is present")
+	}
+}
+
+func TestFindAssetTriesEveryArchAlias(t *testing.T) {
+	assets := []releaseAsset{
+		{Name: "snap-plugin-collector-psutil_linux_aarch64", URL: "https://example.com/bin"},
+	}
+
+	asset, err := findAsset(assets, "snap-plugin-collector-psutil", defaultAssetNameTemplate, "linux", "arm64")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if asset.URL != "https://example.com/bin" {
+		t.Fatalf("expected arm64 to match via its aarch64 alias")
+	}
+}
+
+func TestFindAssetErrorListsAvailableNames(t *testing.T) {
+	assets := []releaseAsset{{Name: "snap-plugin-collector-psutil_windows_x86_64.exe"}}
+
+	_, err := findAsset(assets, "snap-plugin-collector-psutil", defaultAssetNameTemplate, "linux", "amd64")
+	if err == nil {
+		t.Fatalf("expected an error for an unsupported platform")
+	}
+	notFound, ok := err.(*assetNotFoundError)
+	if !ok {
+		t.Fatalf("expected *assetNotFoundError, got %T", err)
+	}
+	if len(notFound.available) != 1 || notFound.available[0] != "snap-plugin-collector-psutil_windows_x86_64.exe" {
+		t.Fatalf("expected the error to list the available asset, got %v", notFound.available)
+	}
+}
+
+func TestParseChecksums(t *testing.T) {
+	body := []byte(
+		"abc123  snap-plugin-collector-psutil_linux_x86_64\n" +
+			"def456  snap-plugin-collector-psutil_darwin_x86_64\n\n",
+	)
+
+	sums := parseChecksums(body)
+	if len(sums) != 2 {
+		t.Fatalf("expected 2 parsed checksums, got %d", len(sums))
+	}
+	if sums["snap-plugin-collector-psutil_linux_x86_64"] != "abc123" {
+		t.Fatalf("unexpected digest for linux asset: %q", sums["snap-plugin-collector-psutil_linux_x86_64"])
+	}
+}
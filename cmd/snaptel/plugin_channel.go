@@ -0,0 +1,615 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/blang/semver"
+	"github.com/urfave/cli"
+	"github.com/yosuke-furukawa/json5/encoding/json5"
+)
+
+// PluginChannel is a single configured plugin source, modeled after the
+// micro editor's channel/repository distribution scheme. Type selects
+// which CatalogSource backend the channel is read by:
+//
+//   - "" or "json5" (the default): URL is a JSON(5) list of
+//     PluginRepository entries, as consumed by fetchRegistry and
+//     `snapctl plugin search`/`install`/`update`.
+//   - "github": URL names a GitHub org, searched via githubOrgCatalogSource.
+//   - "directory": URL is a local directory of plugin manifests, read via
+//     directoryCatalogSource.
+//   - "oci": URL names an OCI registry, pulled via ociCatalogSource.
+//
+// Keeping every channel type in the same channels.json means
+// `snapctl plugin list` (backed by catalogSources) and
+// `snapctl plugin search`/`install` (backed by fetchRegistry) are
+// configured the same way, instead of needing two incompatible setups to
+// point both at the same mirror.
+type PluginChannel struct {
+	Name string `json:"name"`
+	Type string `json:"type,omitempty"`
+	URL  string `json:"url"`
+}
+
+// jsonChannels returns the configured channels whose Type selects the
+// JSON5 channel/repository registry (fetchRegistry), i.e. every channel
+// with no Type or an explicit "json5" Type.
+func jsonChannels(channels []PluginChannel) []PluginChannel {
+	var out []PluginChannel
+	for _, c := range channels {
+		if c.Type == "" || c.Type == "json5" {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// PluginRepository is a URL to a JSON(5) list of packages offered by a
+// single author or organization.
+type PluginRepository struct {
+	URL string `json:"url"`
+}
+
+// PluginPackage describes a single publishable plugin and every version
+// of it that is available for install.
+type PluginPackage struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Author      string          `json:"author"`
+	Tags        []string        `json:"tags"`
+	Versions    []PluginVersion `json:"versions"`
+}
+
+// PluginVersion is a single installable artifact of a PluginPackage.
+type PluginVersion struct {
+	Version      string             `json:"version"`
+	URL          string             `json:"url"`
+	Signature    string             `json:"signature,omitempty"`
+	Dependencies []PluginDependency `json:"dependencies"`
+}
+
+// PluginDependency names another plugin package and the semver range of
+// it that satisfies this version.
+type PluginDependency struct {
+	Name  string `json:"name"`
+	Range string `json:"range"`
+}
+
+func (pv PluginVersion) semver() (semver.Version, error) {
+	return semver.Parse(strings.TrimPrefix(pv.Version, "v"))
+}
+
+// pluginConfigDir returns the directory snapctl stores its plugin channel
+// configuration and caches in, creating it if necessary.
+func pluginConfigDir() (string, error) {
+	home := os.Getenv("HOME")
+	if home == "" {
+		return "", fmt.Errorf("Unable to determine home directory")
+	}
+	dir := filepath.Join(home, ".snap", "plugins")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+func channelsFile() (string, error) {
+	dir, err := pluginConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "channels.json"), nil
+}
+
+func loadChannels() ([]PluginChannel, error) {
+	path, err := channelsFile()
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return []PluginChannel{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var channels []PluginChannel
+	if err := json.Unmarshal(body, &channels); err != nil {
+		return nil, err
+	}
+	return channels, nil
+}
+
+func saveChannels(channels []PluginChannel) error {
+	path, err := channelsFile()
+	if err != nil {
+		return err
+	}
+	body, err := json.MarshalIndent(channels, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, body, 0644)
+}
+
+// validChannelTypes are the Type values pluginChannelAdd accepts, matching
+// the CatalogSource backends catalogSources knows how to construct.
+var validChannelTypes = map[string]bool{
+	"":          true,
+	"json5":     true,
+	"github":    true,
+	"directory": true,
+	"oci":       true,
+}
+
+func pluginChannelAdd(ctx *cli.Context) error {
+	if len(ctx.Args()) != 2 && len(ctx.Args()) != 3 {
+		return newUsageError("Usage: snapctl plugin channel add <name> <url> [type]", ctx)
+	}
+	name, url := ctx.Args().Get(0), ctx.Args().Get(1)
+	channelType := ctx.Args().Get(2)
+	if !validChannelTypes[channelType] {
+		return fmt.Errorf("Unknown channel type %q (expected one of json5, github, directory, oci)", channelType)
+	}
+	channels, err := loadChannels()
+	if err != nil {
+		return err
+	}
+	for _, c := range channels {
+		if c.Name == name {
+			return fmt.Errorf("Channel %s already exists", name)
+		}
+	}
+	channels = append(channels, PluginChannel{Name: name, Type: channelType, URL: url})
+	if err := saveChannels(channels); err != nil {
+		return err
+	}
+	fmt.Printf("Added channel %s (%s)\n", name, url)
+	return nil
+}
+
+func pluginChannelList(ctx *cli.Context) error {
+	channels, err := loadChannels()
+	if err != nil {
+		return err
+	}
+	if len(channels) == 0 {
+		fmt.Println("No plugin channels configured. Add one with `snapctl plugin channel add <name> <url> [type]`.")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+	printFields(w, false, 0, "NAME", "TYPE", "URL")
+	for _, c := range channels {
+		printFields(w, false, 0, c.Name, c.Type, c.URL)
+	}
+	w.Flush()
+	return nil
+}
+
+func pluginChannelRemove(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		return newUsageError("Usage: snapctl plugin channel remove <name>", ctx)
+	}
+	name := ctx.Args().First()
+	channels, err := loadChannels()
+	if err != nil {
+		return err
+	}
+	kept := channels[:0]
+	found := false
+	for _, c := range channels {
+		if c.Name == name {
+			found = true
+			continue
+		}
+		kept = append(kept, c)
+	}
+	if !found {
+		return fmt.Errorf("No such channel: %s", name)
+	}
+	if err := saveChannels(kept); err != nil {
+		return err
+	}
+	fmt.Printf("Removed channel %s\n", name)
+	return nil
+}
+
+// fetchJSON5 fetches a URL and decodes it as JSON5 so channel/repository
+// authors can annotate their files with comments.
+func fetchJSON5(url string, v interface{}) error {
+	body, err := getPluginData(url)
+	if err != nil {
+		return fmt.Errorf("Error fetching %s: %v", url, err)
+	}
+	if err := json5.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("Error parsing %s: %v", url, err)
+	}
+	return nil
+}
+
+// fetchRegistry concurrently fetches every configured channel, the
+// repositories each channel lists, and every package each repository
+// lists, merging the results into a single registry keyed by package
+// name. Fetch errors for individual channels/repositories are collected
+// but do not abort the whole registry build.
+func fetchRegistry(channels []PluginChannel) (map[string]PluginPackage, []error) {
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		registry = make(map[string]PluginPackage)
+		errs     []error
+	)
+
+	addErr := func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	}
+
+	for _, channel := range channels {
+		wg.Add(1)
+		go func(channel PluginChannel) {
+			defer wg.Done()
+			var repos []PluginRepository
+			if err := fetchJSON5(channel.URL, &repos); err != nil {
+				addErr(err)
+				return
+			}
+			for _, repo := range repos {
+				wg.Add(1)
+				go func(repo PluginRepository) {
+					defer wg.Done()
+					var pkgs []PluginPackage
+					if err := fetchJSON5(repo.URL, &pkgs); err != nil {
+						addErr(err)
+						return
+					}
+					mu.Lock()
+					for _, pkg := range pkgs {
+						registry[pkg.Name] = pkg
+					}
+					mu.Unlock()
+				}(repo)
+			}
+		}(channel)
+	}
+	wg.Wait()
+
+	return registry, errs
+}
+
+func pluginSearch(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		return newUsageError("Usage: snapctl plugin search <query>", ctx)
+	}
+	query := ctx.Args().First()
+
+	channels, err := loadChannels()
+	if err != nil {
+		return err
+	}
+	registry, errs := fetchRegistry(jsonChannels(channels))
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, "warning:", err)
+	}
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+	printFields(w, false, 0, "NAME", "AUTHOR", "DESCRIPTION")
+	for _, name := range names {
+		pkg := registry[name]
+		if !strings.Contains(pkg.Name, query) && !strings.Contains(pkg.Description, query) {
+			continue
+		}
+		printFields(w, false, 0, pkg.Name, pkg.Author, pkg.Description)
+	}
+	w.Flush()
+	return nil
+}
+
+// resolvedVersion is a single package/version pair picked by the
+// dependency resolver.
+type resolvedVersion struct {
+	pkg PluginPackage
+	ver PluginVersion
+}
+
+// resolveDependencies walks the dependency graph rooted at name@rng,
+// choosing the highest version of each package that satisfies every
+// range it is required at. It returns an error naming the package if two
+// requirements on it are disjoint.
+func resolveDependencies(registry map[string]PluginPackage, name, rng string) (map[string]resolvedVersion, error) {
+	ranges := make(map[string][]semver.Range)
+	resolved := make(map[string]resolvedVersion)
+
+	var resolve func(name, rng string) error
+	resolve = func(name, rng string) error {
+		// Package names and versions come from remote channel/repository
+		// data; reject anything that could later escape the plugin
+		// config directory as a path component before it is ever used
+		// to build a download destination or manifest path.
+		if !isSafePathComponent(name) {
+			return fmt.Errorf("Invalid plugin package name: %q", name)
+		}
+
+		// semver.ParseRange has no bare wildcard; ">=0.0.0" matches any
+		// version.
+		if rng == "*" {
+			rng = ">=0.0.0"
+		}
+		r, err := semver.ParseRange(rng)
+		if err != nil {
+			return fmt.Errorf("Invalid version range %q for %s: %v", rng, name, err)
+		}
+		ranges[name] = append(ranges[name], r)
+
+		pkg, ok := registry[name]
+		if !ok {
+			return fmt.Errorf("Unknown plugin package: %s", name)
+		}
+
+		var best *PluginVersion
+		var bestSemver semver.Version
+		for i := range pkg.Versions {
+			v := pkg.Versions[i]
+			sv, err := v.semver()
+			if err != nil {
+				continue
+			}
+			satisfiesAll := true
+			for _, existing := range ranges[name] {
+				if !existing(sv) {
+					satisfiesAll = false
+					break
+				}
+			}
+			if !satisfiesAll {
+				continue
+			}
+			if best == nil || sv.GT(bestSemver) {
+				best = &v
+				bestSemver = sv
+			}
+		}
+		if best == nil {
+			return fmt.Errorf("No version of %s satisfies all required ranges (%v)", name, ranges[name])
+		}
+		if !isSafePathComponent(best.Version) {
+			return fmt.Errorf("Invalid version %q for plugin package %s", best.Version, name)
+		}
+
+		if existing, ok := resolved[name]; ok && existing.ver.Version == best.Version {
+			return nil
+		}
+
+		resolved[name] = resolvedVersion{pkg: pkg, ver: *best}
+		for _, dep := range best.Dependencies {
+			if err := resolve(dep.Name, dep.Range); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := resolve(name, rng); err != nil {
+		return nil, err
+	}
+	return resolved, nil
+}
+
+// splitNameRange splits "name@range" into its name and range parts,
+// defaulting to the wildcard range when none is given.
+func splitNameRange(arg string) (string, string) {
+	parts := strings.SplitN(arg, "@", 2)
+	if len(parts) == 1 {
+		return parts[0], "*"
+	}
+	return parts[0], parts[1]
+}
+
+func pluginInstall(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		return newUsageError("Usage: snapctl plugin install <name>[@<range>]", ctx)
+	}
+	name, rng := splitNameRange(ctx.Args().First())
+
+	channels, err := loadChannels()
+	if err != nil {
+		return err
+	}
+	registry, errs := fetchRegistry(jsonChannels(channels))
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, "warning:", err)
+	}
+
+	resolved, err := resolveDependencies(registry, name, rng)
+	if err != nil {
+		return fmt.Errorf("Error resolving dependencies: %v", err)
+	}
+
+	// Download, verify, and load every resolved artifact, unloading only
+	// what *this* install loaded if a later one fails so the user isn't
+	// left half-installed - and so a failure never touches plugins that
+	// were already running before the install started.
+	var loaded []loadedRef
+	for pkgName, rv := range resolved {
+		digest, err := download(rv.ver.URL, fmt.Sprintf("%s-%s", pkgName, rv.ver.Version))
+		if err != nil {
+			unloadAll(loaded)
+			return fmt.Errorf("Error installing %s: %v", pkgName, err)
+		}
+		var sigDigest string
+		if rv.ver.Signature != "" {
+			sigDigest, err = fetchAndStoreSignature(rv.ver.Signature)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "warning: %v, installing %s unsigned\n", err, pkgName)
+			}
+		}
+
+		if err := storeManifest(PluginManifest{
+			Name:            pkgName,
+			Version:         rv.ver.Version,
+			Digest:          digest,
+			SignatureDigest: sigDigest,
+			Dependencies:    rv.ver.Dependencies,
+		}); err != nil {
+			unloadAll(loaded)
+			return fmt.Errorf("Error recording manifest for %s: %v", pkgName, err)
+		}
+
+		path, err := loadVerifiedPlugin(pkgName, rv.ver.Version)
+		if err != nil {
+			unloadAll(loaded)
+			return fmt.Errorf("Error verifying %s: %v", pkgName, err)
+		}
+
+		r := pClient.LoadPlugin([]string{path})
+		if r.Err != nil {
+			unloadAll(loaded)
+			return fmt.Errorf("Error loading %s: %v", pkgName, r.Err.Error())
+		}
+		for _, lp := range r.LoadedPlugins {
+			loaded = append(loaded, loadedRef{Type: lp.Type, Name: lp.Name, Version: lp.Version})
+		}
+		fmt.Printf("Installed %s@%s (sha256:%s)\n", pkgName, rv.ver.Version, digest)
+	}
+
+	return nil
+}
+
+// loadedRef identifies a single plugin instance pClient.LoadPlugin
+// loaded, precisely enough to unload it again.
+type loadedRef struct {
+	Type    string
+	Name    string
+	Version int
+}
+
+// unloadAll unloads exactly the plugins this install loaded - never
+// anything else that happened to be running on the box - so a failed
+// install can roll back without touching pre-existing state.
+func unloadAll(refs []loadedRef) {
+	for _, ref := range refs {
+		pClient.UnloadPlugin(ref.Type, ref.Name, ref.Version)
+	}
+}
+
+func pluginUpdate(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		return newUsageError("Usage: snapctl plugin update <name>", ctx)
+	}
+	return pluginInstall(ctx)
+}
+
+func pluginRemove(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		return newUsageError("Usage: snapctl plugin remove <name>", ctx)
+	}
+	name := ctx.Args().First()
+	plugins := pClient.GetPlugins(false)
+	if plugins.Err != nil {
+		return fmt.Errorf("Error: %v\n", plugins.Err)
+	}
+	removed := false
+	for _, lp := range plugins.LoadedPlugins {
+		if lp.Name == name {
+			r := pClient.UnloadPlugin(lp.Type, lp.Name, lp.Version)
+			if r.Err != nil {
+				return fmt.Errorf("Error removing %s: %v", name, r.Err.Error())
+			}
+			removed = true
+		}
+	}
+	if !removed {
+		return fmt.Errorf("No loaded plugin named %s", name)
+	}
+
+	// Drop this package's refs along with it so its blobs become
+	// unreferenced and `snapctl plugin gc` can reclaim them. A package
+	// installed but never loaded has no refs to remove; that's fine.
+	if err := removePluginRefs(name); err != nil {
+		return fmt.Errorf("Error removing %s: %v", name, err)
+	}
+
+	fmt.Printf("Removed %s\n", name)
+	return nil
+}
+
+// pluginChannelCommand is the `snapctl plugin channel` subcommand group.
+var pluginChannelCommand = cli.Command{
+	Name:  "channel",
+	Usage: "Manage plugin channels",
+	Subcommands: []cli.Command{
+		{
+			Name:   "add",
+			Usage:  "snapctl plugin channel add <name> <url> [type]",
+			Action: pluginChannelAdd,
+		},
+		{
+			Name:   "list",
+			Usage:  "snapctl plugin channel list",
+			Action: pluginChannelList,
+		},
+		{
+			Name:   "remove",
+			Usage:  "snapctl plugin channel remove <name>",
+			Action: pluginChannelRemove,
+		},
+	},
+}
+
+var pluginSearchCommand = cli.Command{
+	Name:   "search",
+	Usage:  "snapctl plugin search <query>",
+	Action: pluginSearch,
+}
+
+var pluginInstallCommand = cli.Command{
+	Name:   "install",
+	Usage:  "snapctl plugin install <name>[@<range>]",
+	Action: pluginInstall,
+}
+
+var pluginUpdateCommand = cli.Command{
+	Name:   "update",
+	Usage:  "snapctl plugin update <name>",
+	Action: pluginUpdate,
+}
+
+var pluginRemoveCommand = cli.Command{
+	Name:   "remove",
+	Usage:  "snapctl plugin remove <name>",
+	Action: pluginRemove,
+}
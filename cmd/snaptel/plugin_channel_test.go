@@ -0,0 +1,142 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import "testing"
+
+func TestResolveDependenciesPicksHighestSatisfyingVersion(t *testing.T) {
+	registry := map[string]PluginPackage{
+		"foo": {
+			Name: "foo",
+			Versions: []PluginVersion{
+				{Version: "1.0.0"},
+				{Version: "1.2.0"},
+				{Version: "2.0.0"},
+			},
+		},
+	}
+
+	resolved, err := resolveDependencies(registry, "foo", ">=1.0.0 <1.1.0 || >=1.2.0 <1.3.0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := resolved["foo"].ver.Version; got != "1.2.0" {
+		t.Fatalf("expected 1.2.0, got %s", got)
+	}
+}
+
+func TestResolveDependenciesWalksTransitiveDeps(t *testing.T) {
+	registry := map[string]PluginPackage{
+		"foo": {
+			Name: "foo",
+			Versions: []PluginVersion{
+				{Version: "1.0.0", Dependencies: []PluginDependency{{Name: "bar", Range: ">=1.0.0"}}},
+			},
+		},
+		"bar": {
+			Name:     "bar",
+			Versions: []PluginVersion{{Version: "1.0.0"}},
+		},
+	}
+
+	resolved, err := resolveDependencies(registry, "foo", ">=1.0.0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := resolved["bar"]; !ok {
+		t.Fatalf("expected transitive dependency bar to be resolved")
+	}
+}
+
+func TestResolveDependenciesDetectsDisjointRanges(t *testing.T) {
+	registry := map[string]PluginPackage{
+		"foo": {
+			Name: "foo",
+			Versions: []PluginVersion{
+				{Version: "1.0.0", Dependencies: []PluginDependency{
+					{Name: "shared", Range: "<1.0.0"},
+					{Name: "shared", Range: ">=2.0.0"},
+				}},
+			},
+		},
+		"shared": {
+			Name: "shared",
+			Versions: []PluginVersion{
+				{Version: "0.5.0"},
+				{Version: "2.0.0"},
+			},
+		},
+	}
+
+	if _, err := resolveDependencies(registry, "foo", ">=1.0.0"); err == nil {
+		t.Fatalf("expected disjoint ranges on shared to produce an error")
+	}
+}
+
+func TestResolveDependenciesHandlesDependencyCycles(t *testing.T) {
+	registry := map[string]PluginPackage{
+		"foo": {
+			Name: "foo",
+			Versions: []PluginVersion{
+				{Version: "1.0.0", Dependencies: []PluginDependency{{Name: "bar", Range: ">=1.0.0"}}},
+			},
+		},
+		"bar": {
+			Name: "bar",
+			Versions: []PluginVersion{
+				{Version: "1.0.0", Dependencies: []PluginDependency{{Name: "foo", Range: ">=1.0.0"}}},
+			},
+		},
+	}
+
+	resolved, err := resolveDependencies(registry, "foo", ">=1.0.0")
+	if err != nil {
+		t.Fatalf("expected a cycle between foo and bar to resolve rather than loop forever: %v", err)
+	}
+	if len(resolved) != 2 {
+		t.Fatalf("expected both foo and bar resolved exactly once, got %d entries", len(resolved))
+	}
+}
+
+func TestResolveDependenciesRejectsUnsafeNames(t *testing.T) {
+	registry := map[string]PluginPackage{
+		"../../etc/evil": {
+			Name:     "../../etc/evil",
+			Versions: []PluginVersion{{Version: "1.0.0"}},
+		},
+	}
+
+	if _, err := resolveDependencies(registry, "../../etc/evil", ">=1.0.0"); err == nil {
+		t.Fatalf("expected a path-traversal package name to be rejected")
+	}
+}
+
+func TestResolveDependenciesRejectsUnsafeVersions(t *testing.T) {
+	registry := map[string]PluginPackage{
+		"foo": {
+			Name:     "foo",
+			Versions: []PluginVersion{{Version: "../../etc/evil"}},
+		},
+	}
+
+	if _, err := resolveDependencies(registry, "foo", ">=0.0.0"); err == nil {
+		t.Fatalf("expected a path-traversal version string to be rejected")
+	}
+}
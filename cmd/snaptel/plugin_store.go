@@ -0,0 +1,436 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/openpgp"
+)
+
+// PluginManifest records everything needed to reproduce and verify a
+// single installed plugin artifact. Like the artifact it describes, the
+// manifest itself is stored content-addressed.
+type PluginManifest struct {
+	Name            string             `json:"name"`
+	Type            string             `json:"type"`
+	Version         string             `json:"version"`
+	Digest          string             `json:"digest"`
+	SignatureDigest string             `json:"signature_digest,omitempty"`
+	Dependencies    []PluginDependency `json:"dependencies,omitempty"`
+}
+
+func blobStoreDir() (string, error) {
+	dir, err := pluginConfigDir()
+	if err != nil {
+		return "", err
+	}
+	blobs := filepath.Join(dir, "blobs", "sha256")
+	if err := os.MkdirAll(blobs, 0755); err != nil {
+		return "", err
+	}
+	return blobs, nil
+}
+
+// isSafePathComponent reports whether s is safe to use as a single path
+// element under the plugin config directory. Package names and versions
+// come from remote, potentially untrusted channel/repository data, so
+// anything that could escape that directory - path separators, "..",
+// or an empty string - is rejected before it ever reaches filepath.Join.
+func isSafePathComponent(s string) bool {
+	if s == "" || s == "." || s == ".." {
+		return false
+	}
+	return !strings.ContainsAny(s, "/\\")
+}
+
+// pluginRefsPath returns the refs/<name> directory for a plugin package
+// without creating it.
+func pluginRefsPath(name string) (string, error) {
+	if !isSafePathComponent(name) {
+		return "", fmt.Errorf("Invalid plugin name: %q", name)
+	}
+	dir, err := pluginConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "refs", name), nil
+}
+
+func refsDir(name string) (string, error) {
+	refs, err := pluginRefsPath(name)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(refs, 0755); err != nil {
+		return "", err
+	}
+	return refs, nil
+}
+
+// removePluginRefs deletes every refs/<name>/<version> symlink for a
+// plugin package, dropping its blobs' last references so a subsequent
+// `snapctl plugin gc` can reclaim them.
+func removePluginRefs(name string) error {
+	refs, err := pluginRefsPath(name)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(refs)
+}
+
+// sha256File returns the lowercase hex SHA-256 digest of the file at path.
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// storeBlob copies the file at path into the content-addressable blob
+// store and returns its digest. Storing a blob that already exists is a
+// no-op beyond recomputing the digest, so repeated installs of the same
+// artifact dedup automatically.
+func storeBlob(path string) (digest string, err error) {
+	digest, err = sha256File(path)
+	if err != nil {
+		return "", err
+	}
+	blobs, err := blobStoreDir()
+	if err != nil {
+		return "", err
+	}
+	dest := filepath.Join(blobs, digest)
+	if _, err := os.Stat(dest); err == nil {
+		return digest, nil
+	}
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(dest, body, 0644); err != nil {
+		return "", err
+	}
+	return digest, nil
+}
+
+func blobPath(digest string) (string, error) {
+	blobs, err := blobStoreDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(blobs, digest), nil
+}
+
+// storeManifest writes m to the blob store, content-addressed by its own
+// JSON encoding, and updates the refs/<name>/<version> symlink to point
+// at it.
+func storeManifest(m PluginManifest) error {
+	body, err := json.MarshalIndent(m, "", "    ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile("", "snap-manifest-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		return err
+	}
+	tmp.Close()
+
+	digest, err := storeBlob(tmp.Name())
+	if err != nil {
+		return err
+	}
+	blob, err := blobPath(digest)
+	if err != nil {
+		return err
+	}
+
+	refs, err := refsDir(m.Name)
+	if err != nil {
+		return err
+	}
+	if !isSafePathComponent(m.Version) {
+		return fmt.Errorf("Invalid plugin version: %q", m.Version)
+	}
+	ref := filepath.Join(refs, m.Version)
+	os.Remove(ref)
+	return os.Symlink(blob, ref)
+}
+
+func loadManifest(name, version string) (PluginManifest, error) {
+	var m PluginManifest
+	refs, err := refsDir(name)
+	if err != nil {
+		return m, err
+	}
+	if !isSafePathComponent(version) {
+		return m, fmt.Errorf("Invalid plugin version: %q", version)
+	}
+	body, err := ioutil.ReadFile(filepath.Join(refs, version))
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(body, &m); err != nil {
+		return m, err
+	}
+	return m, nil
+}
+
+// verifyBlob confirms the file at path has the digest recorded in its
+// manifest.
+func verifyBlob(path, digest string) error {
+	actual, err := sha256File(path)
+	if err != nil {
+		return err
+	}
+	if actual != digest {
+		return fmt.Errorf("Digest mismatch for %s: expected %s, got %s", path, digest, actual)
+	}
+	return nil
+}
+
+// verifySignature checks the detached .asc signature at ascPath against
+// path using the keyring configured for snapctl. If no keyring is
+// configured, signature verification is skipped.
+func verifySignature(path, ascPath, keyringPath string) error {
+	if keyringPath == "" {
+		return nil
+	}
+	keyringFile, err := os.Open(keyringPath)
+	if err != nil {
+		return fmt.Errorf("Error opening keyring %s: %v", keyringPath, err)
+	}
+	defer keyringFile.Close()
+
+	keyring, err := openpgp.ReadArmoredKeyRing(keyringFile)
+	if err != nil {
+		return fmt.Errorf("Error reading keyring %s: %v", keyringPath, err)
+	}
+
+	signed, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer signed.Close()
+
+	sig, err := os.Open(ascPath)
+	if err != nil {
+		return err
+	}
+	defer sig.Close()
+
+	if _, err := openpgp.CheckArmoredDetachedSignature(keyring, signed, sig); err != nil {
+		return fmt.Errorf("Signature verification failed for %s: %v", path, err)
+	}
+	return nil
+}
+
+// keyringPath returns the GPG keyring snapctl verifies plugin signatures
+// against, or "" if no keyring has been configured - in which case
+// signature verification is skipped.
+func keyringPath() string {
+	dir, err := pluginConfigDir()
+	if err != nil {
+		return ""
+	}
+	path := filepath.Join(dir, "keyring.gpg")
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// fetchAndStoreSignature downloads the detached signature at ascURL and
+// stores it in the blob store like any other content, returning its
+// digest. Callers treat a fetch failure as "this artifact isn't signed"
+// rather than a hard error, since not every channel publishes one.
+func fetchAndStoreSignature(ascURL string) (digest string, err error) {
+	resp, err := http.Get(ascURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("no signature published at %s (%s)", ascURL, resp.Status)
+	}
+
+	tmp, err := ioutil.TempFile("", "snap-sig-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	return storeBlob(tmp.Name())
+}
+
+// loadVerifiedPlugin verifies the on-disk blob for name@version against
+// its manifest digest, and its signature (if one was recorded in the
+// manifest) against the configured keyring, before returning the path
+// snapctl should hand to pClient.LoadPlugin.
+func loadVerifiedPlugin(name, version string) (string, error) {
+	m, err := loadManifest(name, version)
+	if err != nil {
+		return "", fmt.Errorf("No manifest found for %s@%s: %v", name, version, err)
+	}
+	path, err := blobPath(m.Digest)
+	if err != nil {
+		return "", err
+	}
+	if err := verifyBlob(path, m.Digest); err != nil {
+		return "", err
+	}
+	if m.SignatureDigest != "" {
+		ascPath, err := blobPath(m.SignatureDigest)
+		if err != nil {
+			return "", err
+		}
+		if err := verifySignature(path, ascPath, keyringPath()); err != nil {
+			return "", err
+		}
+	}
+	return path, nil
+}
+
+func pluginGC(ctx *cli.Context) error {
+	blobs, err := blobStoreDir()
+	if err != nil {
+		return err
+	}
+	dir, err := pluginConfigDir()
+	if err != nil {
+		return err
+	}
+	refsRoot := filepath.Join(dir, "refs")
+
+	// Every ref points at a manifest blob, not the plugin binary it
+	// describes - so the manifest itself must be read to also protect
+	// the digest and signature digest it records. Otherwise the binary
+	// blob has zero direct refs and gc deletes it out from under every
+	// installed plugin on its very first run.
+	referenced := make(map[string]bool)
+	err = filepath.Walk(refsRoot, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info == nil || info.IsDir() {
+			return nil
+		}
+		target, err := os.Readlink(path)
+		if err != nil {
+			return nil
+		}
+		manifestDigest := filepath.Base(target)
+		referenced[manifestDigest] = true
+
+		body, err := ioutil.ReadFile(target)
+		if err != nil {
+			return nil
+		}
+		var m PluginManifest
+		if err := json.Unmarshal(body, &m); err != nil {
+			return nil
+		}
+		if m.Digest != "" {
+			referenced[m.Digest] = true
+		}
+		if m.SignatureDigest != "" {
+			referenced[m.SignatureDigest] = true
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	entries, err := ioutil.ReadDir(blobs)
+	if err != nil {
+		return err
+	}
+	removed := 0
+	for _, entry := range entries {
+		if referenced[entry.Name()] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(blobs, entry.Name())); err != nil {
+			return err
+		}
+		removed++
+	}
+	fmt.Printf("Removed %d unreferenced blob(s)\n", removed)
+	return nil
+}
+
+func pluginInspect(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		return newUsageError("Usage: snapctl plugin inspect <name>@<version>", ctx)
+	}
+	name, version := splitNameRange(ctx.Args().First())
+	if version == "*" {
+		return fmt.Errorf("Must provide an explicit version: snapctl plugin inspect %s@<version>", name)
+	}
+	m, err := loadManifest(name, version)
+	if err != nil {
+		return err
+	}
+	body, err := json.MarshalIndent(m, "", "    ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(body))
+	return nil
+}
+
+var pluginGCCommand = cli.Command{
+	Name:   "gc",
+	Usage:  "Remove unreferenced plugin blobs",
+	Action: pluginGC,
+}
+
+var pluginInspectCommand = cli.Command{
+	Name:   "inspect",
+	Usage:  "snapctl plugin inspect <name>@<version>",
+	Action: pluginInspect,
+}
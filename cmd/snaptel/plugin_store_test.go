@@ -0,0 +1,126 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/urfave/cli"
+)
+
+// withTempHome points HOME at a fresh temporary directory for the
+// duration of a test, so pluginConfigDir resolves underneath it instead
+// of the real user's ~/.snap.
+func withTempHome(t *testing.T) func() {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "snap-gc-test-")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	old := os.Getenv("HOME")
+	os.Setenv("HOME", dir)
+	return func() {
+		os.Setenv("HOME", old)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestPluginGCPreservesBinaryAndSignatureBlobs(t *testing.T) {
+	defer withTempHome(t)()
+
+	binary, err := ioutil.TempFile("", "snap-gc-binary-")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.Remove(binary.Name())
+	binary.WriteString("plugin binary")
+	binary.Close()
+	binaryDigest, err := storeBlob(binary.Name())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sig, err := ioutil.TempFile("", "snap-gc-sig-")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.Remove(sig.Name())
+	sig.WriteString("signature")
+	sig.Close()
+	sigDigest, err := storeBlob(sig.Name())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := storeManifest(PluginManifest{
+		Name:            "foo",
+		Version:         "1.0.0",
+		Digest:          binaryDigest,
+		SignatureDigest: sigDigest,
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := pluginGC(&cli.Context{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	blobs, err := blobStoreDir()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(blobs, binaryDigest)); err != nil {
+		t.Fatalf("expected the referenced plugin binary blob to survive gc: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(blobs, sigDigest)); err != nil {
+		t.Fatalf("expected the referenced signature blob to survive gc: %v", err)
+	}
+}
+
+func TestPluginGCRemovesUnreferencedBlobs(t *testing.T) {
+	defer withTempHome(t)()
+
+	orphan, err := ioutil.TempFile("", "snap-gc-orphan-")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.Remove(orphan.Name())
+	orphan.WriteString("nobody points at me")
+	orphan.Close()
+	orphanDigest, err := storeBlob(orphan.Name())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := pluginGC(&cli.Context{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	blobs, err := blobStoreDir()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(blobs, orphanDigest)); err == nil {
+		t.Fatalf("expected the unreferenced blob to be removed by gc")
+	}
+}
@@ -0,0 +1,289 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progressReader wraps an io.Reader and renders a single-line terminal
+// progress bar as bytes are read through it.
+type progressReader struct {
+	r          io.Reader
+	label      string
+	total      int64 // <= 0 if unknown (no Content-Length)
+	downloaded int64
+	start      time.Time
+	lastDraw   time.Time
+}
+
+func newProgressReader(r io.Reader, label string, total int64) *progressReader {
+	return &progressReader{r: r, label: label, total: total, start: time.Now()}
+}
+
+func (p *progressReader) Read(buf []byte) (int, error) {
+	n, err := p.r.Read(buf)
+	p.downloaded += int64(n)
+	if time.Since(p.lastDraw) > 100*time.Millisecond || err == io.EOF {
+		p.draw()
+		p.lastDraw = time.Now()
+	}
+	if err == io.EOF {
+		fmt.Println()
+	}
+	return n, err
+}
+
+func (p *progressReader) draw() {
+	elapsed := time.Since(p.start).Seconds()
+	throughput := float64(p.downloaded) / elapsed
+	if elapsed == 0 {
+		throughput = 0
+	}
+
+	if p.total <= 0 {
+		fmt.Printf("\r%s: %s downloaded (%s/s)", p.label, humanBytes(p.downloaded), humanBytes(int64(throughput)))
+		return
+	}
+
+	pct := float64(p.downloaded) / float64(p.total) * 100
+	const width = 30
+	filled := int(float64(width) * pct / 100)
+	if filled > width {
+		filled = width
+	}
+	bar := ""
+	for i := 0; i < width; i++ {
+		if i < filled {
+			bar += "="
+		} else {
+			bar += " "
+		}
+	}
+
+	var eta string
+	if throughput > 0 {
+		remaining := float64(p.total-p.downloaded) / throughput
+		eta = time.Duration(remaining * float64(time.Second)).Round(time.Second).String()
+	} else {
+		eta = "?"
+	}
+
+	fmt.Printf("\r%s [%s] %3.0f%% %s/%s %s/s ETA %s", p.label, bar, pct, humanBytes(p.downloaded), humanBytes(p.total), humanBytes(int64(throughput)), eta)
+}
+
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// urlDigest is used to name a stable partial-download file so an
+// interrupted transfer can be resumed on a later run of snapctl.
+func urlDigest(url string) string {
+	h := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(h[:])
+}
+
+func partialDownloadPath(url string) (string, error) {
+	dir, err := pluginConfigDir()
+	if err != nil {
+		return "", err
+	}
+	partials := dir + string(os.PathSeparator) + "partial"
+	if err := os.MkdirAll(partials, 0755); err != nil {
+		return "", err
+	}
+	return partials + string(os.PathSeparator) + urlDigest(url), nil
+}
+
+// httpGetRangeRetry issues a GET with an optional Range header,
+// retrying with exponential backoff on 5xx responses and transient
+// network errors. rangeHeader is sent verbatim (e.g. "bytes=100-" to
+// resume, "bytes=100-199" for a single chunk) and omitted entirely when
+// empty.
+func httpGetRangeRetry(url, rangeHeader string) (*http.Response, error) {
+	const maxAttempts = 5
+	var lastErr error
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if attempt > 0 {
+			backoff := time.Duration(1<<uint(attempt))*time.Second + time.Duration(rand.Intn(250))*time.Millisecond
+			time.Sleep(backoff)
+		}
+
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode >= 500 {
+			resp.Body.Close()
+			lastErr = fmt.Errorf("server returned %s", resp.Status)
+			continue
+		}
+		return resp, nil
+	}
+
+	return nil, fmt.Errorf("Error after %d attempts: %v", maxAttempts, lastErr)
+}
+
+// httpGetRetry issues a GET, resuming from rangeStart with an
+// open-ended Range header when rangeStart > 0, retrying with
+// exponential backoff on 5xx responses and transient network errors.
+func httpGetRetry(url string, rangeStart int64) (*http.Response, error) {
+	rangeHeader := ""
+	if rangeStart > 0 {
+		rangeHeader = fmt.Sprintf("bytes=%d-", rangeStart)
+	}
+	return httpGetRangeRetry(url, rangeHeader)
+}
+
+// downloadChunked fetches url into the blob store using parts concurrent
+// range requests, reassembling them into a single file before hashing.
+// It requires the server to report Content-Length and accept Range
+// requests; callers should fall back to the sequential download when it
+// returns an error.
+func downloadChunked(url, name string, parts int) (digest string, err error) {
+	fileName := name
+	if fileName == "" {
+		tokens := strings.Split(url, "/")
+		fileName = tokens[len(tokens)-1]
+	}
+
+	head, err := http.Head(url)
+	if err != nil {
+		return "", fmt.Errorf("Error checking %s: %v", url, err)
+	}
+	head.Body.Close()
+	if head.Header.Get("Accept-Ranges") != "bytes" || head.ContentLength <= 0 {
+		return "", fmt.Errorf("%s does not support ranged downloads", url)
+	}
+
+	partial, err := partialDownloadPath(url)
+	if err != nil {
+		return "", err
+	}
+	output, err := os.OpenFile(partial, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", fmt.Errorf("Error while creating %s: %v", partial, err)
+	}
+	defer output.Close()
+	if err := output.Truncate(head.ContentLength); err != nil {
+		return "", err
+	}
+
+	chunkSize := head.ContentLength / int64(parts)
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		chunkErr error
+		done     int64
+	)
+	progress := newProgressReader(nil, fileName, head.ContentLength)
+
+	for i := 0; i < parts; i++ {
+		start := int64(i) * chunkSize
+		end := start + chunkSize - 1
+		if i == parts-1 {
+			end = head.ContentLength - 1
+		}
+
+		wg.Add(1)
+		go func(start, end int64) {
+			defer wg.Done()
+			resp, err := httpGetRangeRetry(url, fmt.Sprintf("bytes=%d-%d", start, end))
+			if err != nil {
+				mu.Lock()
+				chunkErr = err
+				mu.Unlock()
+				return
+			}
+			defer resp.Body.Close()
+
+			buf := make([]byte, 32*1024)
+			offset := start
+			for {
+				n, rerr := resp.Body.Read(buf)
+				if n > 0 {
+					if _, werr := output.WriteAt(buf[:n], offset); werr != nil {
+						mu.Lock()
+						chunkErr = werr
+						mu.Unlock()
+						return
+					}
+					offset += int64(n)
+					mu.Lock()
+					done += int64(n)
+					progress.downloaded = done
+					progress.draw()
+					mu.Unlock()
+				}
+				if rerr == io.EOF {
+					break
+				}
+				if rerr != nil {
+					mu.Lock()
+					chunkErr = rerr
+					mu.Unlock()
+					return
+				}
+			}
+		}(start, end)
+	}
+	wg.Wait()
+	fmt.Println()
+
+	if chunkErr != nil {
+		os.Remove(partial)
+		return "", fmt.Errorf("Error while downloading %s: %v", url, chunkErr)
+	}
+
+	digest, err = storeBlob(partial)
+	if err != nil {
+		return "", fmt.Errorf("Error storing %s in blob store: %v", fileName, err)
+	}
+	os.Remove(partial)
+	return digest, nil
+}